@@ -2,11 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"io/fs"
 	"net/http"
-	"os"
-	"path/filepath"
+	"net/url"
+	"path"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/golang-lru/v2/expirable"
@@ -15,85 +18,249 @@ import (
 	"github.com/operator-framework/operator-registry/alpha/declcfg"
 )
 
+// errNoStatusURLs is returned by catalogAPIBase when a ClusterCatalog hasn't
+// (yet, or ever will) publish status.urls.base. Callers use it to decide
+// whether to fall back to the full-catalog disk cache.
+var errNoStatusURLs = errors.New("cluster catalog has no status.urls.base")
+
 type cachingClient struct {
+	// baseURL is the address of the port-forwarded catalogd service. It is
+	// used as the scheme+host for every request; the path comes from each
+	// ClusterCatalog's own status.urls.base, since catalogd serves catalogs
+	// under a per-catalog path behind that shared host.
 	baseURL    string
-	cacheDir   string
+	store      CatalogStore
 	httpClient *http.Client
-	lru        *expirable.LRU[string, string]
+
+	// metasLRU caches the results of metas sub-API queries, keyed by
+	// catalog name + schema + package, so repeated cold reads against the
+	// same scope don't refetch unless the catalog has actually changed.
+	metasLRU *expirable.LRU[string, metasCacheEntry]
+
+	// subs notifies watch handlers whenever getCatalogFS swaps in a new
+	// snapshot for a catalog.
+	subs *catalogSubscribers
+
+	// graphLRU caches computed channel upgrade graphs, keyed by catalog
+	// snapshot so a new commit to the catalog naturally invalidates every
+	// graph computed from the snapshot before it.
+	graphLRU *expirable.LRU[string, *channelGraph]
+}
+
+type metasCacheEntry struct {
+	metas   []declcfg.Meta
+	modTime time.Time
 }
 
-func newCachingClient(cacheDir string, baseURL string, httpClient *http.Client) *cachingClient {
-	lru := expirable.NewLRU(100, func(_ string, value string) {
-		os.RemoveAll(value)
-	}, time.Hour*24)
+func newCachingClient(store CatalogStore, baseURL string, httpClient *http.Client) *cachingClient {
+	metasLRU := expirable.NewLRU[string, metasCacheEntry](1000, nil, time.Hour*24)
+	graphLRU := expirable.NewLRU[string, *channelGraph](256, nil, time.Hour*24)
 	return &cachingClient{
 		baseURL:    baseURL,
-		cacheDir:   cacheDir,
+		store:      store,
 		httpClient: httpClient,
-		lru:        lru,
+		metasLRU:   metasLRU,
+		subs:       newCatalogSubscribers(),
+		graphLRU:   graphLRU,
 	}
 }
 
-func (c *cachingClient) getCatalogFS(ctx context.Context, clusterCatalog *catalogdv1alpha1.ClusterCatalog) (fs.FS, error) {
-	catalogPath := filepath.Join(c.cacheDir, "clustercatalogs", clusterCatalog.GetName())
-	c.lru.Add(clusterCatalog.GetName(), catalogPath)
+// Subscribe returns a channel that receives a value every time getCatalogFS
+// commits a new snapshot for the named catalog, and a cancel func that must
+// be called to stop receiving and release the channel.
+func (c *cachingClient) Subscribe(name string) (<-chan struct{}, func()) {
+	return c.subs.subscribe(name)
+}
 
-	activeSymlinkPath := filepath.Join(catalogPath, "active")
-	catalogStat, err := os.Stat(activeSymlinkPath)
+// catalogAPIBase returns the base URL of the per-catalog API exposed at
+// clusterCatalog.Status.URLs.Base, rewritten to go through the port-forwarded
+// host in c.baseURL rather than the in-cluster service address.
+func (c *cachingClient) catalogAPIBase(clusterCatalog *catalogdv1alpha1.ClusterCatalog) (*url.URL, error) {
+	if clusterCatalog.Status.URLs == nil || clusterCatalog.Status.URLs.Base == "" {
+		return nil, errNoStatusURLs
+	}
+	statusURL, err := url.Parse(clusterCatalog.Status.URLs.Base)
 	if err != nil {
-		if !os.IsNotExist(err) {
-			return nil, err
-		}
+		return nil, fmt.Errorf("parsing status.urls.base for cluster catalog %q: %w", clusterCatalog.GetName(), err)
 	}
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/catalogs/"+clusterCatalog.GetName()+"/all.json", nil)
+	localURL, err := url.Parse(c.baseURL)
 	if err != nil {
 		return nil, err
 	}
+	statusURL.Scheme = localURL.Scheme
+	statusURL.Host = localURL.Host
+	return statusURL, nil
+}
+
+// getMetas issues a targeted fetch against the catalog's metas sub-API,
+// optionally filtered by schema and/or package, so callers don't have to pull
+// every blob in the catalog just to answer one request. A zero time.Time is
+// returned alongside http.StatusNotModified when the server reports the
+// filtered result set hasn't changed since ifModifiedSince.
+func (c *cachingClient) getMetas(ctx context.Context, clusterCatalog *catalogdv1alpha1.ClusterCatalog, schema, pkg string, ifModifiedSince time.Time) ([]declcfg.Meta, time.Time, error) {
+	base, err := c.catalogAPIBase(clusterCatalog)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	metasURL := base.JoinPath("metas")
+	q := metasURL.Query()
+	if schema != "" {
+		q.Set("schema", schema)
+	}
+	if pkg != "" {
+		q.Set("package", pkg)
+	}
+	metasURL.RawQuery = q.Encode()
 
-	if catalogStat != nil && catalogStat.IsDir() {
-		modTime := catalogStat.ModTime().UTC().Format(http.TimeFormat)
-		req.Header.Set("If-Modified-Since", modTime)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metasURL.String(), nil)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	req.Header.Set("Accept-Encoding", "gzip, zstd")
+	if !ifModifiedSince.IsZero() {
+		req.Header.Set("If-Modified-Since", ifModifiedSince.UTC().Format(http.TimeFormat))
 	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, time.Time{}, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode == http.StatusNotModified {
-		return os.DirFS(activeSymlinkPath), nil
+		return nil, time.Time{}, nil
 	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, err
+		return nil, time.Time{}, fmt.Errorf("fetching metas for cluster catalog %q: unexpected status %s", clusterCatalog.GetName(), resp.Status)
 	}
 
 	modTime, err := http.ParseTime(resp.Header.Get("Last-Modified"))
 	if err != nil {
-		return nil, err
+		return nil, time.Time{}, err
 	}
-	realCatalogPath := filepath.Join(catalogPath, modTime.UTC().Format("20060102_150405"))
+
+	body, err := decodeBody(resp)
 	if err != nil {
-		return nil, err
+		return nil, time.Time{}, err
 	}
-	if err := writeCatalog(realCatalogPath, resp.Body); err != nil {
-		return nil, err
+	defer body.Close()
+
+	var metas []declcfg.Meta
+	if err := declcfg.WalkMetasReader(body, func(m *declcfg.Meta, err error) error {
+		if err != nil {
+			return err
+		}
+		metas = append(metas, *m)
+		return nil
+	}); err != nil {
+		return nil, time.Time{}, err
 	}
-	if err := os.Chtimes(realCatalogPath, modTime, modTime); err != nil {
-		return nil, err
+	return metas, modTime, nil
+}
+
+// queryMetas is the cached entry point handlers use for targeted reads: it
+// wraps getMetas with the metasLRU so a scope that hasn't changed since the
+// last request is answered with a conditional If-Modified-Since request and
+// served from the cache instead of being downloaded again.
+func (c *cachingClient) queryMetas(ctx context.Context, clusterCatalog *catalogdv1alpha1.ClusterCatalog, schema, pkg string) ([]declcfg.Meta, error) {
+	key := clusterCatalog.GetName() + "|" + schema + "|" + pkg
+
+	var ifModifiedSince time.Time
+	if entry, ok := c.metasLRU.Get(key); ok {
+		ifModifiedSince = entry.modTime
 	}
-	nextSymlinkPath := filepath.Join(catalogPath, "next")
-	if err := os.Symlink(filepath.Base(realCatalogPath), filepath.Join(catalogPath, "next")); err != nil {
+
+	metas, modTime, err := c.getMetas(ctx, clusterCatalog, schema, pkg, ifModifiedSince)
+	if err != nil {
 		return nil, err
 	}
-	if err := os.Rename(nextSymlinkPath, activeSymlinkPath); err != nil {
-		return nil, err
+	if modTime.IsZero() {
+		entry, _ := c.metasLRU.Get(key)
+		return entry.metas, nil
+	}
+
+	c.metasLRU.Add(key, metasCacheEntry{metas: metas, modTime: modTime})
+	return metas, nil
+}
+
+// getCatalogFS returns the catalog's current fs.FS along with the modTime of
+// the snapshot it came from, refreshing the store from catalogd first if
+// needed. Callers that cache derived data keyed by catalog state (such as
+// channelGraph) must key off this returned modTime rather than re-querying
+// c.store.Snapshot themselves, since a concurrent refresh can otherwise
+// commit a newer snapshot between the two reads.
+func (c *cachingClient) getCatalogFS(ctx context.Context, clusterCatalog *catalogdv1alpha1.ClusterCatalog) (fs.FS, time.Time, error) {
+	name := clusterCatalog.GetName()
+	activeFS, modTime, err := c.store.Snapshot(ctx, name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, time.Time{}, err
+	}
+
+	var allURL string
+	base, err := c.catalogAPIBase(clusterCatalog)
+	switch {
+	case err == nil:
+		allURL = base.JoinPath("all").String()
+	case errors.Is(err, errNoStatusURLs):
+		// Catalogs without status.urls.base are fetched from the legacy
+		// per-catalog all.json path behind the port-forwarded host.
+		allURL = c.baseURL + "/catalogs/" + name + "/all.json"
+	default:
+		return nil, time.Time{}, err
 	}
-	return os.DirFS(activeSymlinkPath), nil
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, allURL, nil)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	req.Header.Set("Accept-Encoding", "gzip, zstd")
+	if activeFS != nil {
+		req.Header.Set("If-Modified-Since", modTime.UTC().Format(http.TimeFormat))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return activeFS, modTime, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, time.Time{}, fmt.Errorf("fetching catalog %q: unexpected status %s", name, resp.Status)
+	}
+
+	respModTime, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	body, err := decodeBody(resp)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer body.Close()
+
+	w, err := c.store.BeginWrite(ctx, name, respModTime)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if err := writeCatalog(w, body); err != nil {
+		_ = w.Discard()
+		return nil, time.Time{}, err
+	}
+	if err := w.Commit(); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	newFS, newModTime, err := c.store.Snapshot(ctx, name)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	c.subs.notify(name)
+	return newFS, newModTime, nil
 }
 
-func writeCatalog(catalogDir string, r io.Reader) error {
-	if err := declcfg.WalkMetasReader(r, func(m *declcfg.Meta, err error) error {
+func writeCatalog(w CatalogWriter, r io.Reader) error {
+	return declcfg.WalkMetasReader(r, func(m *declcfg.Meta, err error) error {
 		if err != nil {
 			return err
 		}
@@ -104,16 +271,46 @@ func writeCatalog(catalogDir string, r io.Reader) error {
 		if packageName == "" {
 			packageName = "__global"
 		}
-		path := filepath.Join(catalogDir, packageName, m.Schema, m.Name+".json")
-		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-			return err
-		}
-		if err := os.WriteFile(path, m.Blob, 0644); err != nil {
-			return err
+		return w.WriteFile(path.Join(packageName, m.Schema, m.Name+".json"), m.Blob)
+	})
+}
+
+// catalogSubscribers fans out a notification to every watcher of a given
+// catalog name whenever that catalog's cached snapshot changes.
+type catalogSubscribers struct {
+	mu   sync.Mutex
+	subs map[string]map[chan struct{}]struct{}
+}
+
+func newCatalogSubscribers() *catalogSubscribers {
+	return &catalogSubscribers{subs: make(map[string]map[chan struct{}]struct{})}
+}
+
+func (s *catalogSubscribers) subscribe(name string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	s.mu.Lock()
+	if s.subs[name] == nil {
+		s.subs[name] = make(map[chan struct{}]struct{})
+	}
+	s.subs[name][ch] = struct{}{}
+	s.mu.Unlock()
+
+	cancel := func() {
+		s.mu.Lock()
+		delete(s.subs[name], ch)
+		s.mu.Unlock()
+	}
+	return ch, cancel
+}
+
+func (s *catalogSubscribers) notify(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.subs[name] {
+		select {
+		case ch <- struct{}{}:
+		default:
 		}
-		return nil
-	}); err != nil {
-		return err
 	}
-	return nil
 }
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	catalogdv1alpha1 "github.com/operator-framework/catalogd/api/core/v1alpha1"
+)
+
+func testClusterCatalog(t *testing.T, name, statusURLsBase string) *catalogdv1alpha1.ClusterCatalog {
+	t.Helper()
+	cat := &catalogdv1alpha1.ClusterCatalog{}
+	cat.Name = name
+	cat.Status.Phase = catalogdv1alpha1.PhaseUnpacked
+	if statusURLsBase != "" {
+		quoted, err := json.Marshal(statusURLsBase)
+		if err != nil {
+			t.Fatalf("quoting status.urls.base: %v", err)
+		}
+		statusJSON := `{"urls":{"base":` + string(quoted) + `}}`
+		if err := json.Unmarshal([]byte(statusJSON), &cat.Status); err != nil {
+			t.Fatalf("building test ClusterCatalog status: %v", err)
+		}
+	}
+	return cat
+}
+
+func TestCatalogAPIBase(t *testing.T) {
+	cc := &cachingClient{baseURL: "https://localhost:12345"}
+
+	cat := testClusterCatalog(t, "test-catalog", "https://catalogd.cluster.local/catalogs/test-catalog")
+	base, err := cc.catalogAPIBase(cat)
+	if err != nil {
+		t.Fatalf("catalogAPIBase: %v", err)
+	}
+	if base.Scheme != "https" || base.Host != "localhost:12345" {
+		t.Errorf("expected scheme+host rewritten to c.baseURL, got %q", base.String())
+	}
+	if base.Path != "/catalogs/test-catalog" {
+		t.Errorf("expected the original status.urls.base path preserved, got %q", base.Path)
+	}
+
+	noURLs := testClusterCatalog(t, "no-urls", "")
+	if _, err := cc.catalogAPIBase(noURLs); err != errNoStatusURLs {
+		t.Errorf("expected errNoStatusURLs, got %v", err)
+	}
+}
+
+// gzipBody gzip-compresses body for use as an httptest handler's response.
+func gzipBody(t *testing.T, body string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(body)); err != nil {
+		t.Fatalf("gzip write: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("gzip close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestGetMetasDecodesGzipResponse(t *testing.T) {
+	lastModified := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	body := `{"schema":"olm.package","package":"foo","name":"foo"}
+{"schema":"olm.package","package":"bar","name":"bar"}
+`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/catalogs/test/metas" {
+			t.Errorf("unexpected request path %q", r.URL.Path)
+		}
+		if r.Header.Get("Accept-Encoding") == "" {
+			t.Error("expected Accept-Encoding header to be set")
+		}
+		if got := r.URL.Query().Get("schema"); got != "olm.package" {
+			t.Errorf("expected schema query param olm.package, got %q", got)
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+		w.Write(gzipBody(t, body))
+	}))
+	defer srv.Close()
+
+	cc := newCachingClient(NewInMemoryStore(), srv.URL, srv.Client())
+	cat := testClusterCatalog(t, "test", srv.URL+"/catalogs/test")
+
+	metas, modTime, err := cc.getMetas(context.Background(), cat, "olm.package", "", time.Time{})
+	if err != nil {
+		t.Fatalf("getMetas: %v", err)
+	}
+	if len(metas) != 2 {
+		t.Fatalf("expected 2 metas, got %d: %+v", len(metas), metas)
+	}
+	if !modTime.Equal(lastModified) {
+		t.Errorf("expected modTime %v, got %v", lastModified, modTime)
+	}
+	names := map[string]bool{metas[0].Name: true, metas[1].Name: true}
+	if !names["foo"] || !names["bar"] {
+		t.Errorf("expected metas named foo and bar, got %+v", metas)
+	}
+}
+
+func TestGetMetasNotModified(t *testing.T) {
+	ifModifiedSince := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := r.Header.Get("If-Modified-Since")
+		want := ifModifiedSince.UTC().Format(http.TimeFormat)
+		if got != want {
+			t.Errorf("If-Modified-Since = %q, want %q", got, want)
+		}
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer srv.Close()
+
+	cc := newCachingClient(NewInMemoryStore(), srv.URL, srv.Client())
+	cat := testClusterCatalog(t, "test", srv.URL+"/catalogs/test")
+
+	metas, modTime, err := cc.getMetas(context.Background(), cat, "", "", ifModifiedSince)
+	if err != nil {
+		t.Fatalf("getMetas: %v", err)
+	}
+	if metas != nil || !modTime.IsZero() {
+		t.Errorf("expected nil metas and zero modTime on 304, got %+v / %v", metas, modTime)
+	}
+}
+
+func TestQueryMetasServesCacheOnNotModified(t *testing.T) {
+	var requests int
+	lastModified := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+			w.Write([]byte(`{"schema":"olm.package","package":"foo","name":"foo"}` + "\n"))
+			return
+		}
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer srv.Close()
+
+	cc := newCachingClient(NewInMemoryStore(), srv.URL, srv.Client())
+	cat := testClusterCatalog(t, "test", srv.URL+"/catalogs/test")
+
+	first, err := cc.queryMetas(context.Background(), cat, "olm.package", "")
+	if err != nil {
+		t.Fatalf("queryMetas (first): %v", err)
+	}
+	second, err := cc.queryMetas(context.Background(), cat, "olm.package", "")
+	if err != nil {
+		t.Fatalf("queryMetas (second): %v", err)
+	}
+	if requests != 2 {
+		t.Fatalf("expected 2 requests to the metas endpoint, got %d", requests)
+	}
+	if len(first) != 1 || len(second) != 1 || first[0].Name != second[0].Name {
+		t.Errorf("expected the cached result to be served on the second call, got %+v then %+v", first, second)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// decodeBody wraps resp.Body with a decompressor matching its
+// Content-Encoding header. Go's http.Transport only auto-decompresses gzip
+// when the caller hasn't set its own Accept-Encoding header, and never
+// handles zstd, so cachingClient has to do this itself now that it sends
+// Accept-Encoding explicitly.
+func decodeBody(resp *http.Response) (io.ReadCloser, error) {
+	switch resp.Header.Get("Content-Encoding") {
+	case "gzip":
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return &multiCloser{Reader: gz, closers: []io.Closer{gz, resp.Body}}, nil
+	case "zstd":
+		zr, err := zstd.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return &multiCloser{Reader: zr.IOReadCloser(), closers: []io.Closer{zr.IOReadCloser(), resp.Body}}, nil
+	default:
+		return resp.Body, nil
+	}
+}
+
+// multiCloser lets decodeBody return a single io.ReadCloser that closes both
+// the decompressor and the underlying response body.
+type multiCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (m *multiCloser) Close() error {
+	var err error
+	for _, c := range m.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// withCompression wraps an HTTP handler so its response body is gzip- or
+// zstd-encoded when the client advertises support via Accept-Encoding.
+// Responses from listObjectsHandler and getObjectHandler can be large, so
+// this is applied to those two in particular.
+func withCompression(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept := r.Header.Get("Accept-Encoding")
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		switch {
+		case strings.Contains(accept, "zstd"):
+			zw, err := zstd.NewWriter(w)
+			if err != nil {
+				h.ServeHTTP(w, r)
+				return
+			}
+			crw := &compressedResponseWriter{ResponseWriter: w, writer: zw}
+			defer func() {
+				if !crw.bypassed {
+					zw.Close()
+				}
+			}()
+			w.Header().Set("Content-Encoding", "zstd")
+			h.ServeHTTP(crw, r)
+		case strings.Contains(accept, "gzip"):
+			gz := gzip.NewWriter(w)
+			crw := &compressedResponseWriter{ResponseWriter: w, writer: gz}
+			defer func() {
+				if !crw.bypassed {
+					gz.Close()
+				}
+			}()
+			w.Header().Set("Content-Encoding", "gzip")
+			h.ServeHTTP(crw, r)
+		default:
+			h.ServeHTTP(w, r)
+		}
+	})
+}
+
+type compressedResponseWriter struct {
+	http.ResponseWriter
+	writer io.Writer
+
+	// bypassed is set by uncompressedResponseWriter when the wrapped
+	// handler opted out of compression. withCompression's deferred Close
+	// checks this so it doesn't write a compressor header+trailer for a
+	// body that was never actually written through writer.
+	bypassed bool
+}
+
+func (c *compressedResponseWriter) Write(b []byte) (int, error) {
+	return c.writer.Write(b)
+}
+
+// uncompressedResponseWriter returns the http.ResponseWriter a handler
+// wrapped in withCompression should use for a response whose framing
+// (Content-Length, Range, conditional requests) it doesn't control itself,
+// such as one served through http.ServeFileFS. Writing through the
+// compressed writer in that case would compress the body while the framing
+// headers still describe the uncompressed one, corrupting the response; it
+// also marks the writer as bypassed so withCompression's deferred Close
+// doesn't append a compressor header+trailer after the raw body.
+func uncompressedResponseWriter(w http.ResponseWriter) http.ResponseWriter {
+	c, ok := w.(*compressedResponseWriter)
+	if !ok {
+		return w
+	}
+	c.Header().Del("Content-Encoding")
+	c.bypassed = true
+	return c.ResponseWriter
+}
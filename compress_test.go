@@ -0,0 +1,144 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestWithCompressionRoundTrip(t *testing.T) {
+	const body = `{"hello":"world"}`
+
+	cases := []struct {
+		name           string
+		acceptEncoding string
+		wantEncoding   string
+		decode         func(t *testing.T, r io.Reader) string
+	}{
+		{
+			name:           "gzip",
+			acceptEncoding: "gzip",
+			wantEncoding:   "gzip",
+			decode: func(t *testing.T, r io.Reader) string {
+				gr, err := gzip.NewReader(r)
+				if err != nil {
+					t.Fatalf("gzip.NewReader: %v", err)
+				}
+				defer gr.Close()
+				data, err := io.ReadAll(gr)
+				if err != nil {
+					t.Fatalf("reading gzip body: %v", err)
+				}
+				return string(data)
+			},
+		},
+		{
+			name:           "zstd",
+			acceptEncoding: "zstd",
+			wantEncoding:   "zstd",
+			decode: func(t *testing.T, r io.Reader) string {
+				zr, err := zstd.NewReader(r)
+				if err != nil {
+					t.Fatalf("zstd.NewReader: %v", err)
+				}
+				defer zr.Close()
+				data, err := io.ReadAll(zr)
+				if err != nil {
+					t.Fatalf("reading zstd body: %v", err)
+				}
+				return string(data)
+			},
+		},
+		{
+			name:           "no Accept-Encoding support falls through uncompressed",
+			acceptEncoding: "identity",
+			wantEncoding:   "",
+			decode: func(t *testing.T, r io.Reader) string {
+				data, err := io.ReadAll(r)
+				if err != nil {
+					t.Fatalf("reading plain body: %v", err)
+				}
+				return string(data)
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			handler := withCompression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(body))
+			}))
+
+			srv := httptest.NewServer(handler)
+			defer srv.Close()
+
+			req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+			if err != nil {
+				t.Fatalf("NewRequest: %v", err)
+			}
+			req.Header.Set("Accept-Encoding", c.acceptEncoding)
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Do: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if got := resp.Header.Get("Content-Encoding"); got != c.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, c.wantEncoding)
+			}
+			if got := c.decode(t, resp.Body); got != body {
+				t.Errorf("decoded body = %q, want %q", got, body)
+			}
+		})
+	}
+}
+
+// TestWithCompressionBypassDoesNotAppendTrailer is a regression test for a
+// bug where withCompression's deferred Close on the gzip/zstd writer fired
+// even when the wrapped handler opted out of compression via
+// uncompressedResponseWriter (e.g. getObjectHandler's http.ServeFileFS
+// fallback), appending a spurious compressor header+trailer after the raw
+// body.
+func TestWithCompressionBypassDoesNotAppendTrailer(t *testing.T) {
+	const body = `{"hello":"world"}`
+
+	handler := withCompression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw := uncompressedResponseWriter(w)
+		_, _ = raw.Write([]byte(body))
+	}))
+
+	for _, encoding := range []string{"gzip", "zstd"} {
+		t.Run(encoding, func(t *testing.T) {
+			srv := httptest.NewServer(handler)
+			defer srv.Close()
+
+			req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+			if err != nil {
+				t.Fatalf("NewRequest: %v", err)
+			}
+			req.Header.Set("Accept-Encoding", encoding)
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Do: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if got := resp.Header.Get("Content-Encoding"); got != "" {
+				t.Errorf("Content-Encoding = %q, want empty after bypass", got)
+			}
+			data, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("reading body: %v", err)
+			}
+			if string(data) != body {
+				t.Errorf("body = %q, want %q (no trailing compressor bytes)", data, body)
+			}
+		})
+	}
+}
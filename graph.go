@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"sort"
+
+	"github.com/blang/semver/v4"
+	"k8s.io/client-go/dynamic"
+
+	catalogdv1alpha1 "github.com/operator-framework/catalogd/api/core/v1alpha1"
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/alpha/property"
+)
+
+// graphNode is one bundle version in a channel's upgrade graph.
+type graphNode struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// graphEdge is a directed upgrade edge discovered from a channel entry's
+// replaces, skips, or skipRange field. From is always the older bundle, To
+// the newer one.
+type graphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Type string `json:"type"` // "replaces", "skips", or "skipRange"
+}
+
+// channelGraph is a channel's upgrade DAG: every bundle it contains, and
+// every upgrade edge between them.
+type channelGraph struct {
+	Channel string      `json:"channel"`
+	Nodes   []graphNode `json:"nodes"`
+	Edges   []graphEdge `json:"edges"`
+}
+
+// channelGraphHandler serves a channel's upgrade graph: nodes are the
+// bundles it contains, edges are the replaces/skips/skipRange relationships
+// declared between them.
+func channelGraphHandler(dynamicClient dynamic.Interface, cc *cachingClient) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cat, err := getClusterCatalog(r.Context(), dynamicClient, r.PathValue("resource"), r.PathValue("catalogName"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if cat.Status.Phase != catalogdv1alpha1.PhaseUnpacked {
+			http.Error(w, "catalog not unpacked", http.StatusServiceUnavailable)
+			return
+		}
+
+		graph, err := cc.channelGraph(r.Context(), cat, r.PathValue("packageName"), r.PathValue("channelName"))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				http.Error(w, "channel not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(graph); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// upgradePathHandler serves the ordered sequence of bundles a ?from= version
+// must pass through, within ?channel=, to reach the channel head.
+func upgradePathHandler(dynamicClient dynamic.Interface, cc *cachingClient) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cat, err := getClusterCatalog(r.Context(), dynamicClient, r.PathValue("resource"), r.PathValue("catalogName"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if cat.Status.Phase != catalogdv1alpha1.PhaseUnpacked {
+			http.Error(w, "catalog not unpacked", http.StatusServiceUnavailable)
+			return
+		}
+
+		channelName := r.URL.Query().Get("channel")
+		if channelName == "" {
+			http.Error(w, "channel query parameter is required", http.StatusBadRequest)
+			return
+		}
+		fromVersion := r.URL.Query().Get("from")
+		if fromVersion == "" {
+			http.Error(w, "from query parameter is required", http.StatusBadRequest)
+			return
+		}
+
+		graph, err := cc.channelGraph(r.Context(), cat, r.PathValue("packageName"), channelName)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				http.Error(w, "channel not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		path, err := upgradePath(graph, fromVersion)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(path); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// channelGraph returns the cached upgrade graph for packageName/channelName,
+// computing and caching it if the catalog's active snapshot has moved on
+// since the last request.
+func (c *cachingClient) channelGraph(ctx context.Context, cat *catalogdv1alpha1.ClusterCatalog, packageName, channelName string) (*channelGraph, error) {
+	fsys, modTime, err := c.getCatalogFS(ctx, cat)
+	if err != nil {
+		return nil, err
+	}
+
+	key := fmt.Sprintf("%s|%s|%s|%d", cat.GetName(), packageName, channelName, modTime.UnixNano())
+	if graph, ok := c.graphLRU.Get(key); ok {
+		return graph, nil
+	}
+
+	graph, err := buildChannelGraph(fsys, packageName, channelName)
+	if err != nil {
+		return nil, err
+	}
+	c.graphLRU.Add(key, graph)
+	return graph, nil
+}
+
+// buildChannelGraph walks the olm.channel blob for channelName and the
+// olm.bundle blob for each of its entries, producing the channel's upgrade
+// DAG.
+func buildChannelGraph(fsys fs.FS, packageName, channelName string) (*channelGraph, error) {
+	data, err := fs.ReadFile(fsys, filepath.Join(packageName, declcfg.SchemaChannel, channelName+".json"))
+	if err != nil {
+		return nil, err
+	}
+	var ch declcfg.Channel
+	if err := json.Unmarshal(data, &ch); err != nil {
+		return nil, err
+	}
+
+	graph := &channelGraph{Channel: channelName}
+	versions := make(map[string]string, len(ch.Entries))
+	for _, entry := range ch.Entries {
+		v, err := bundleVersion(fsys, packageName, entry.Name)
+		if err != nil {
+			return nil, err
+		}
+		versions[entry.Name] = v.String()
+		graph.Nodes = append(graph.Nodes, graphNode{Name: entry.Name, Version: v.String()})
+	}
+
+	for _, entry := range ch.Entries {
+		if entry.Replaces != "" {
+			graph.Edges = append(graph.Edges, graphEdge{From: entry.Replaces, To: entry.Name, Type: "replaces"})
+		}
+		for _, skip := range entry.Skips {
+			graph.Edges = append(graph.Edges, graphEdge{From: skip, To: entry.Name, Type: "skips"})
+		}
+		if entry.SkipRange == "" {
+			continue
+		}
+		skipRange, err := semver.ParseRange(entry.SkipRange)
+		if err != nil {
+			continue
+		}
+		for name, rawVersion := range versions {
+			if name == entry.Name {
+				continue
+			}
+			v, err := semver.Parse(rawVersion)
+			if err == nil && skipRange(v) {
+				graph.Edges = append(graph.Edges, graphEdge{From: name, To: entry.Name, Type: "skipRange"})
+			}
+		}
+	}
+
+	sort.Slice(graph.Nodes, func(i, j int) bool { return graph.Nodes[i].Name < graph.Nodes[j].Name })
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].From != graph.Edges[j].From {
+			return graph.Edges[i].From < graph.Edges[j].From
+		}
+		return graph.Edges[i].To < graph.Edges[j].To
+	})
+	return graph, nil
+}
+
+// bundleVersion reads packageName's olm.bundle blob for bundleName and
+// extracts its version from the bundle's olm.package property, the FBC
+// mechanism for declaring which package+version a bundle implements.
+func bundleVersion(fsys fs.FS, packageName, bundleName string) (semver.Version, error) {
+	data, err := fs.ReadFile(fsys, filepath.Join(packageName, declcfg.SchemaBundle, bundleName+".json"))
+	if err != nil {
+		return semver.Version{}, err
+	}
+	var bundle declcfg.Bundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return semver.Version{}, err
+	}
+	for _, p := range bundle.Properties {
+		if p.Type != property.TypePackage {
+			continue
+		}
+		var pkgProp property.Package
+		if err := json.Unmarshal(p.Value, &pkgProp); err != nil {
+			continue
+		}
+		return semver.Parse(pkgProp.Version)
+	}
+	return semver.Version{}, fmt.Errorf("bundle %q has no olm.package property", bundleName)
+}
+
+// upgradePath returns the shortest chain of upgrade edges in graph from the
+// bundle at fromVersion to the channel head, inclusive of both ends.
+func upgradePath(graph *channelGraph, fromVersion string) ([]graphNode, error) {
+	nodesByName := make(map[string]graphNode, len(graph.Nodes))
+	for _, n := range graph.Nodes {
+		nodesByName[n.Name] = n
+	}
+
+	var fromName string
+	for _, n := range graph.Nodes {
+		if n.Version == fromVersion {
+			fromName = n.Name
+			break
+		}
+	}
+	if fromName == "" {
+		return nil, fmt.Errorf("version %q not found in channel %q", fromVersion, graph.Channel)
+	}
+
+	head, err := channelHead(graph)
+	if err != nil {
+		return nil, err
+	}
+	if fromName == head {
+		return []graphNode{nodesByName[head]}, nil
+	}
+
+	adjacency := make(map[string][]string, len(graph.Nodes))
+	for _, e := range graph.Edges {
+		adjacency[e.From] = append(adjacency[e.From], e.To)
+	}
+
+	visited := map[string]bool{fromName: true}
+	queue := [][]string{{fromName}}
+	var path []string
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		last := cur[len(cur)-1]
+		if last == head {
+			path = cur
+			break
+		}
+		for _, next := range adjacency[last] {
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+			nextPath := append(append([]string{}, cur...), next)
+			queue = append(queue, nextPath)
+		}
+	}
+	if path == nil {
+		return nil, fmt.Errorf("no upgrade path from %q to the head of channel %q", fromVersion, graph.Channel)
+	}
+
+	nodes := make([]graphNode, 0, len(path))
+	for _, name := range path {
+		nodes = append(nodes, nodesByName[name])
+	}
+	return nodes, nil
+}
+
+// channelHead returns the name of the channel's head bundle: the entry
+// nothing else in the channel replaces, per the "replaces" edges in graph.
+// A well-formed channel has exactly one such entry, but semver is used to
+// break ties (or to pick among entries when the channel has no "replaces"
+// edges at all) rather than as the primary signal, since a later release
+// can legitimately carry a lower version number (e.g. a backport).
+func channelHead(graph *channelGraph) (string, error) {
+	if len(graph.Nodes) == 0 {
+		return "", fmt.Errorf("channel %q has no entries", graph.Channel)
+	}
+
+	replaced := make(map[string]bool, len(graph.Edges))
+	for _, e := range graph.Edges {
+		if e.Type == "replaces" {
+			replaced[e.From] = true
+		}
+	}
+
+	candidates := make([]graphNode, 0, len(graph.Nodes))
+	for _, n := range graph.Nodes {
+		if !replaced[n.Name] {
+			candidates = append(candidates, n)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = graph.Nodes
+	}
+
+	head := candidates[0]
+	headVersion, err := semver.Parse(head.Version)
+	if err != nil {
+		return "", err
+	}
+	for _, n := range candidates[1:] {
+		v, err := semver.Parse(n.Version)
+		if err != nil {
+			return "", err
+		}
+		if v.GT(headVersion) {
+			head, headVersion = n, v
+		}
+	}
+	return head.Name, nil
+}
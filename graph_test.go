@@ -0,0 +1,144 @@
+package main
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func bundleFile(version string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(`{
+		"schema": "olm.bundle",
+		"package": "pkg",
+		"properties": [
+			{"type": "olm.package", "value": {"packageName": "pkg", "version": "` + version + `"}}
+		]
+	}`)}
+}
+
+func testChannelFS() fstest.MapFS {
+	return fstest.MapFS{
+		"pkg/olm.channel/stable.json": &fstest.MapFile{Data: []byte(`{
+			"schema": "olm.channel",
+			"package": "pkg",
+			"name": "stable",
+			"entries": [
+				{"name": "pkg.v1.0.0"},
+				{"name": "pkg.v1.1.0", "replaces": "pkg.v1.0.0"},
+				{"name": "pkg.v1.2.0", "replaces": "pkg.v1.1.0", "skips": ["pkg.v1.0.0"], "skipRange": "<1.2.0"}
+			]
+		}`)},
+		"pkg/olm.bundle/pkg.v1.0.0.json": bundleFile("1.0.0"),
+		"pkg/olm.bundle/pkg.v1.1.0.json": bundleFile("1.1.0"),
+		"pkg/olm.bundle/pkg.v1.2.0.json": bundleFile("1.2.0"),
+	}
+}
+
+func TestBuildChannelGraph(t *testing.T) {
+	graph, err := buildChannelGraph(testChannelFS(), "pkg", "stable")
+	if err != nil {
+		t.Fatalf("buildChannelGraph: %v", err)
+	}
+	if len(graph.Nodes) != 3 {
+		t.Fatalf("expected 3 nodes, got %d", len(graph.Nodes))
+	}
+
+	var replaces, skips, skipRanges int
+	for _, e := range graph.Edges {
+		switch e.Type {
+		case "replaces":
+			replaces++
+		case "skips":
+			skips++
+		case "skipRange":
+			skipRanges++
+		}
+	}
+	if replaces != 2 {
+		t.Errorf("expected 2 replaces edges, got %d", replaces)
+	}
+	if skips != 1 {
+		t.Errorf("expected 1 skips edge, got %d", skips)
+	}
+	// pkg.v1.2.0's skipRange "<1.2.0" matches both 1.0.0 and 1.1.0.
+	if skipRanges != 2 {
+		t.Errorf("expected 2 skipRange edges, got %d", skipRanges)
+	}
+}
+
+func TestBuildChannelGraphMissingVersion(t *testing.T) {
+	fsys := testChannelFS()
+	delete(fsys, "pkg/olm.bundle/pkg.v1.1.0.json")
+
+	if _, err := buildChannelGraph(fsys, "pkg", "stable"); err == nil {
+		t.Fatal("expected error for channel entry with missing bundle, got nil")
+	}
+}
+
+func TestChannelHead(t *testing.T) {
+	graph, err := buildChannelGraph(testChannelFS(), "pkg", "stable")
+	if err != nil {
+		t.Fatalf("buildChannelGraph: %v", err)
+	}
+	head, err := channelHead(graph)
+	if err != nil {
+		t.Fatalf("channelHead: %v", err)
+	}
+	if head != "pkg.v1.2.0" {
+		t.Errorf("expected head pkg.v1.2.0, got %q", head)
+	}
+}
+
+func TestChannelHeadPrefersReplacesChainOverSemverMax(t *testing.T) {
+	// pkg.v1.0.1 is a backport that replaces pkg.v1.1.0 despite its lower
+	// version number, so it must win as the head over the semver-max node.
+	fsys := fstest.MapFS{
+		"pkg/olm.channel/stable.json": &fstest.MapFile{Data: []byte(`{
+			"schema": "olm.channel",
+			"package": "pkg",
+			"name": "stable",
+			"entries": [
+				{"name": "pkg.v1.0.0"},
+				{"name": "pkg.v1.1.0", "replaces": "pkg.v1.0.0"},
+				{"name": "pkg.v1.0.1", "replaces": "pkg.v1.1.0"}
+			]
+		}`)},
+		"pkg/olm.bundle/pkg.v1.0.0.json": bundleFile("1.0.0"),
+		"pkg/olm.bundle/pkg.v1.1.0.json": bundleFile("1.1.0"),
+		"pkg/olm.bundle/pkg.v1.0.1.json": bundleFile("1.0.1"),
+	}
+
+	graph, err := buildChannelGraph(fsys, "pkg", "stable")
+	if err != nil {
+		t.Fatalf("buildChannelGraph: %v", err)
+	}
+	head, err := channelHead(graph)
+	if err != nil {
+		t.Fatalf("channelHead: %v", err)
+	}
+	if head != "pkg.v1.0.1" {
+		t.Errorf("expected replaces-chain head pkg.v1.0.1, got %q", head)
+	}
+}
+
+func TestUpgradePath(t *testing.T) {
+	graph, err := buildChannelGraph(testChannelFS(), "pkg", "stable")
+	if err != nil {
+		t.Fatalf("buildChannelGraph: %v", err)
+	}
+
+	path, err := upgradePath(graph, "1.0.0")
+	if err != nil {
+		t.Fatalf("upgradePath: %v", err)
+	}
+	// pkg.v1.2.0 skips pkg.v1.0.0, so the shortest path is a single hop.
+	if len(path) != 2 {
+		t.Fatalf("expected a 2-node path from 1.0.0 to head, got %d: %+v", len(path), path)
+	}
+	if path[0].Name != "pkg.v1.0.0" || path[len(path)-1].Name != "pkg.v1.2.0" {
+		t.Errorf("unexpected path endpoints: %+v", path)
+	}
+
+	if _, err := upgradePath(graph, "9.9.9"); err == nil {
+		t.Fatal("expected error for a version not present in the channel, got nil")
+	}
+}
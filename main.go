@@ -14,27 +14,38 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/homedir"
 
 	catalogdv1alpha1 "github.com/operator-framework/catalogd/api/core/v1alpha1"
 	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/alpha/property"
 )
 
+var clusterCatalogGVR = schema.GroupVersionResource{Group: "catalogd.operatorframework.io", Version: "v1alpha1", Resource: "clustercatalogs"}
+
 func main() {
 	var (
-		kubeconfig string
-		namespace  string
-		service    string
-		localPort  uint
-		destPort   uint
-		cacheRoot  string
+		kubeconfig      string
+		namespace       string
+		service         string
+		localPort       uint
+		destPort        uint
+		cacheRoot       string
+		cacheBackend    string
+		cacheS3Bucket   string
+		cacheS3Prefix   string
+		cacheS3Endpoint string
 	)
 
 	if home := homedir.HomeDir(); home != "" {
@@ -47,7 +58,11 @@ func main() {
 	flag.UintVar(&localPort, "local-port", 0, "local port to listen on")
 	flag.UintVar(&destPort, "dest-port", 443, "destination port to forward")
 
-	flag.StringVar(&cacheRoot, "cache-root", "cache", "root directory to cache catalog data")
+	flag.StringVar(&cacheRoot, "cache-root", "cache", "root directory to cache catalog data (local cache backend only)")
+	flag.StringVar(&cacheBackend, "cache-backend", "local", `storage backend for cached catalog data: "local", "memory", or "s3"`)
+	flag.StringVar(&cacheS3Bucket, "cache-s3-bucket", "", "S3 bucket to cache catalog data in (s3 cache backend only)")
+	flag.StringVar(&cacheS3Prefix, "cache-s3-prefix", "console-etl", "key prefix within the S3 bucket to cache catalog data under (s3 cache backend only)")
+	flag.StringVar(&cacheS3Endpoint, "cache-s3-endpoint", "", "S3-compatible endpoint override (s3 cache backend only)")
 	flag.Parse()
 
 	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
@@ -55,6 +70,11 @@ func main() {
 		log.Fatalf("failed to build kubeconfig: %v", err)
 	}
 
+	store, err := newCatalogStore(cacheBackend, cacheRoot, cacheS3Bucket, cacheS3Prefix, cacheS3Endpoint)
+	if err != nil {
+		log.Fatalf("failed to initialize cache backend: %v", err)
+	}
+
 	spf, err := openServicePortForward(context.Background(), cfg, uint16(localPort), uint16(destPort), types.NamespacedName{Namespace: namespace, Name: service})
 	if err != nil {
 		log.Fatalf("failed to open port forward: %v", err)
@@ -69,25 +89,70 @@ func main() {
 
 	httpTransport := http.DefaultTransport.(*http.Transport).Clone()
 	httpTransport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-	cc := newCachingClient(cacheRoot, fmt.Sprintf("https://localhost:%d", spf.localPort), &http.Client{
+	cc := newCachingClient(store, fmt.Sprintf("https://localhost:%d", spf.localPort), &http.Client{
 		Transport: httpTransport,
 	})
 
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	startClusterCatalogInformer(dynamicClient, cc, stopCh)
+
 	// Standard generic endpoints
 	http.Handle("GET /{resource}", listResourceInstancesHandler(dynamicClient))
 	http.Handle("GET /{resource}/{catalogName}", getCatalogHandler(dynamicClient))
 	http.Handle("GET /{resource}/{catalogName}/packages", listPackagesHandler(dynamicClient, cc))
 	http.Handle("GET /{resource}/{catalogName}/packages/{packageName}", listPackageSchemasHandler(dynamicClient, cc))
-	http.Handle("GET /{resource}/{catalogName}/packages/{packageName}/{schema}", listObjectsHandler(dynamicClient, cc))
-	http.Handle("GET /{resource}/{catalogName}/packages/{packageName}/{schema}/{objectName}", getObjectHandler(dynamicClient, cc))
+	http.Handle("GET /{resource}/{catalogName}/packages/{packageName}/{schema}", withCompression(listObjectsHandler(dynamicClient, cc)))
+	http.Handle("GET /{resource}/{catalogName}/packages/{packageName}/{schema}/{objectName}", withCompression(getObjectHandler(dynamicClient, cc)))
 
 	// Custom endpoints
 	http.Handle("GET /{resource}/{catalogName}/packages/{packageName}/icon", getPackageIconHandler(dynamicClient, cc))
+	http.Handle("GET /{resource}/{catalogName}/packages/{packageName}/channels/{channelName}/graph", channelGraphHandler(dynamicClient, cc))
+	http.Handle("GET /{resource}/{catalogName}/packages/{packageName}/upgrade", upgradePathHandler(dynamicClient, cc))
+
+	// Watch endpoints
+	http.Handle("GET /{resource}/{catalogName}/watch", watchCatalogHandler(dynamicClient, cc))
+	http.Handle("GET /{resource}/{catalogName}/packages/{packageName}/watch", watchPackageHandler(dynamicClient, cc))
 
 	log.Println("Listening on :8080")
 	_ = http.ListenAndServe(":8080", nil)
 }
 
+// startClusterCatalogInformer watches ClusterCatalog resources and
+// proactively refreshes cc's cache whenever one resolves a new digest, so
+// watch handlers notice cluster-side changes without waiting for the next
+// poll from an HTTP client.
+func startClusterCatalogInformer(dynamicClient dynamic.Interface, cc *cachingClient, stopCh <-chan struct{}) {
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, 10*time.Minute)
+	informer := factory.ForResource(clusterCatalogGVR).Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj any) { refreshClusterCatalogCache(cc, obj) },
+		UpdateFunc: func(_, obj any) { refreshClusterCatalogCache(cc, obj) },
+	})
+	factory.Start(stopCh)
+	factory.WaitForCacheSync(stopCh)
+}
+
+func refreshClusterCatalogCache(cc *cachingClient, obj any) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	var cat catalogdv1alpha1.ClusterCatalog
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &cat); err != nil {
+		log.Printf("failed to decode cluster catalog %q: %v", u.GetName(), err)
+		return
+	}
+	if cat.Status.Phase != catalogdv1alpha1.PhaseUnpacked {
+		return
+	}
+	go func() {
+		if _, _, err := cc.getCatalogFS(context.Background(), &cat); err != nil {
+			log.Printf("failed to refresh cache for cluster catalog %q: %v", cat.GetName(), err)
+		}
+	}()
+}
+
 func listResourceInstancesHandler(dynamicClient dynamic.Interface) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		uList, err := dynamicClient.Resource(schema.GroupVersionResource{Group: "catalogd.operatorframework.io", Version: "v1alpha1", Resource: r.PathValue("resource")}).List(context.Background(), metav1.ListOptions{})
@@ -134,35 +199,154 @@ func listPackagesHandler(dynamicClient dynamic.Interface, cc *cachingClient) htt
 			return
 		}
 
-		fsys, err := cc.getCatalogFS(context.Background(), cat)
+		opts, err := parseListOptions(r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		entries, err := fs.ReadDir(fsys, ".")
+		metas, err := currentPackageMetas(r.Context(), cc, cat)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		packageNames := make([]string, 0, len(entries))
-		for _, entry := range entries {
-			if entry.IsDir() {
-				packageNames = append(packageNames, entry.Name())
+		byName := make(map[string]declcfg.Meta, len(metas))
+		names := make([]string, 0, len(metas))
+		for _, m := range metas {
+			if !opts.matchesName(m.Name) || !opts.matchesLabels(m) {
+				continue
 			}
+			byName[m.Name] = m
+			names = append(names, m.Name)
 		}
-		sort.Strings(packageNames)
+		sort.Strings(names)
+		page, hasMore := paginate(names, opts)
 
-		enc := json.NewEncoder(w)
-		enc.SetEscapeHTML(false)
-		if err := enc.Encode(packageNames); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		fields := splitFields(r.URL.Query().Get("fields"))
+		if len(fields) == 0 {
+			writeList(w, r, len(names), page, lastOf(page), hasMore)
 			return
 		}
+
+		projected := make([]map[string]any, 0, len(page))
+		for _, name := range page {
+			var pkg declcfg.Package
+			if err := json.Unmarshal(byName[name].Blob, &pkg); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			projected = append(projected, projectPackageFields(pkg, fields))
+		}
+		writeList(w, r, len(names), projected, lastOf(page), hasMore)
 	})
 }
 
+// splitFields parses a comma-separated ?fields= value into its components,
+// returning nil (not projected) when the parameter is absent.
+func splitFields(raw string) []string {
+	if raw == "" {
+		return nil
+	}
+	return strings.Split(raw, ",")
+}
+
+// projectPackageFields slims pkg down to the requested fields so a console
+// can render a package list without fetching every package's full blob.
+func projectPackageFields(pkg declcfg.Package, fields []string) map[string]any {
+	out := make(map[string]any, len(fields))
+	for _, field := range fields {
+		switch field {
+		case "name":
+			out["name"] = pkg.Name
+		case "defaultChannel":
+			out["defaultChannel"] = pkg.DefaultChannel
+		case "description":
+			out["description"] = pkg.Description
+		case "schema":
+			out["schema"] = pkg.Schema
+		}
+	}
+	return out
+}
+
+// lastOf returns the final element of names, or "" if it's empty.
+func lastOf(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	return names[len(names)-1]
+}
+
+// currentPackageMetas returns the olm.package Meta for every package in cat,
+// preferring the targeted metas API and falling back to a full-catalog walk
+// when the catalog hasn't published status.urls.base. It's shared by
+// listPackagesHandler and the catalog-level watch handler.
+func currentPackageMetas(ctx context.Context, cc *cachingClient, cat *catalogdv1alpha1.ClusterCatalog) ([]declcfg.Meta, error) {
+	metas, err := cc.queryMetas(ctx, cat, declcfg.SchemaPackage, "")
+	if errors.Is(err, errNoStatusURLs) {
+		return packageMetasFromFS(ctx, cc, cat)
+	}
+	return metas, err
+}
+
+// currentPackageNames is a convenience over currentPackageMetas for callers
+// that only need package names, like the catalog-level watch handler.
+func currentPackageNames(ctx context.Context, cc *cachingClient, cat *catalogdv1alpha1.ClusterCatalog) ([]string, error) {
+	metas, err := currentPackageMetas(ctx, cc, cat)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(metas))
+	for _, m := range metas {
+		names = append(names, m.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// packageMetasFromFS is the full-catalog fallback used when a ClusterCatalog
+// hasn't published status.urls.base and the targeted metas API isn't
+// available.
+func packageMetasFromFS(ctx context.Context, cc *cachingClient, cat *catalogdv1alpha1.ClusterCatalog) ([]declcfg.Meta, error) {
+	fsys, _, err := cc.getCatalogFS(ctx, cat)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	metas := make([]declcfg.Meta, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		data, err := fs.ReadFile(fsys, filepath.Join(name, declcfg.SchemaPackage, name+".json"))
+		if err != nil {
+			return nil, err
+		}
+		metas = append(metas, declcfg.Meta{Schema: declcfg.SchemaPackage, Package: name, Name: name, Blob: data, Properties: propertiesFromBlob(data)})
+	}
+	return metas, nil
+}
+
+// propertiesFromBlob reconstructs the "properties" field of an FBC blob so
+// that objects read from the FS fallback can still be filtered by
+// ?labelSelector=, the same as objects read through the metas sub-API. A
+// malformed or absent properties field is treated as "no properties" rather
+// than an error, matching declcfg's own tolerance for partial blobs.
+func propertiesFromBlob(data []byte) []property.Property {
+	var blob struct {
+		Properties []property.Property `json:"properties"`
+	}
+	if err := json.Unmarshal(data, &blob); err != nil {
+		return nil
+	}
+	return blob.Properties
+}
+
 func listPackageSchemasHandler(dynamicClient dynamic.Interface, cc *cachingClient) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		cat, err := getClusterCatalog(r.Context(), dynamicClient, r.PathValue("resource"), r.PathValue("catalogName"))
@@ -176,34 +360,62 @@ func listPackageSchemasHandler(dynamicClient dynamic.Interface, cc *cachingClien
 			return
 		}
 
-		fsys, err := cc.getCatalogFS(context.Background(), cat)
+		opts, err := parseListOptions(r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		entries, err := fs.ReadDir(fsys, r.PathValue("packageName"))
+		var schemaNames []string
+		metas, err := cc.queryMetas(r.Context(), cat, "", r.PathValue("packageName"))
+		if errors.Is(err, errNoStatusURLs) {
+			schemaNames, err = listPackageSchemasFromFS(r.Context(), cc, cat, r.PathValue("packageName"))
+		} else if err == nil {
+			seen := make(map[string]bool, len(metas))
+			for _, m := range metas {
+				if !seen[m.Schema] {
+					seen[m.Schema] = true
+					schemaNames = append(schemaNames, m.Schema)
+				}
+			}
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		schemaNames := make([]string, 0, len(entries))
-		for _, entry := range entries {
-			if entry.IsDir() {
-				schemaNames = append(schemaNames, entry.Name())
+		filtered := schemaNames[:0:0]
+		for _, name := range schemaNames {
+			if opts.matchesName(name) {
+				filtered = append(filtered, name)
 			}
 		}
-		sort.Strings(schemaNames)
-		enc := json.NewEncoder(w)
-		enc.SetEscapeHTML(false)
-		if err := enc.Encode(schemaNames); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+		sort.Strings(filtered)
+		page, hasMore := paginate(filtered, opts)
+		writeList(w, r, len(filtered), page, lastOf(page), hasMore)
 	})
 }
 
+// listPackageSchemasFromFS is the full-catalog fallback used when a
+// ClusterCatalog hasn't published status.urls.base.
+func listPackageSchemasFromFS(ctx context.Context, cc *cachingClient, cat *catalogdv1alpha1.ClusterCatalog, packageName string) ([]string, error) {
+	fsys, _, err := cc.getCatalogFS(ctx, cat)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := fs.ReadDir(fsys, packageName)
+	if err != nil {
+		return nil, err
+	}
+	schemaNames := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			schemaNames = append(schemaNames, entry.Name())
+		}
+	}
+	return schemaNames, nil
+}
+
 func listObjectsHandler(dynamicClient dynamic.Interface, cc *cachingClient) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		cat, err := getClusterCatalog(r.Context(), dynamicClient, r.PathValue("resource"), r.PathValue("catalogName"))
@@ -217,35 +429,80 @@ func listObjectsHandler(dynamicClient dynamic.Interface, cc *cachingClient) http
 			return
 		}
 
-		fsys, err := cc.getCatalogFS(context.Background(), cat)
+		opts, err := parseListOptions(r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		entries, err := fs.ReadDir(fsys, filepath.Join(r.PathValue("packageName"), r.PathValue("schema")))
+		metas, err := currentObjectMetas(r.Context(), cc, cat, r.PathValue("packageName"), r.PathValue("schema"))
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		objectNames := make([]string, 0, len(entries))
-		for _, entry := range entries {
-			if !entry.IsDir() {
-				objectNames = append(objectNames, strings.TrimSuffix(entry.Name(), ".json"))
+		byName := make(map[string]declcfg.Meta, len(metas))
+		names := make([]string, 0, len(metas))
+		for _, m := range metas {
+			if !opts.matchesName(m.Name) || !opts.matchesLabels(m) {
+				continue
 			}
+			byName[m.Name] = m
+			names = append(names, m.Name)
 		}
-		sort.Strings(objectNames)
+		sort.Strings(names)
+		page, hasMore := paginate(names, opts)
 
-		enc := json.NewEncoder(w)
-		enc.SetEscapeHTML(false)
-		if err := enc.Encode(objectNames); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if r.URL.Query().Get("deref") != "true" {
+			writeList(w, r, len(names), page, lastOf(page), hasMore)
 			return
 		}
+
+		blobs := make([]json.RawMessage, 0, len(page))
+		for _, name := range page {
+			blobs = append(blobs, json.RawMessage(byName[name].Blob))
+		}
+		writeList(w, r, len(names), blobs, lastOf(page), hasMore)
 	})
 }
 
+// currentObjectMetas returns the Meta for every object of the given schema in
+// packageName, preferring the targeted metas API and falling back to a
+// full-catalog walk when the catalog hasn't published status.urls.base.
+func currentObjectMetas(ctx context.Context, cc *cachingClient, cat *catalogdv1alpha1.ClusterCatalog, packageName, schemaName string) ([]declcfg.Meta, error) {
+	metas, err := cc.queryMetas(ctx, cat, schemaName, packageName)
+	if errors.Is(err, errNoStatusURLs) {
+		return objectMetasFromFS(ctx, cc, cat, packageName, schemaName)
+	}
+	return metas, err
+}
+
+// objectMetasFromFS is the full-catalog fallback used when a ClusterCatalog
+// hasn't published status.urls.base.
+func objectMetasFromFS(ctx context.Context, cc *cachingClient, cat *catalogdv1alpha1.ClusterCatalog, packageName, schemaName string) ([]declcfg.Meta, error) {
+	fsys, _, err := cc.getCatalogFS(ctx, cat)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := fs.ReadDir(fsys, filepath.Join(packageName, schemaName))
+	if err != nil {
+		return nil, err
+	}
+	metas := make([]declcfg.Meta, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), ".json")
+		data, err := fs.ReadFile(fsys, filepath.Join(packageName, schemaName, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		metas = append(metas, declcfg.Meta{Schema: schemaName, Package: packageName, Name: name, Blob: data, Properties: propertiesFromBlob(data)})
+	}
+	return metas, nil
+}
+
 func getObjectHandler(dynamicClient dynamic.Interface, cc *cachingClient) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		cat, err := getClusterCatalog(r.Context(), dynamicClient, r.PathValue("resource"), r.PathValue("catalogName"))
@@ -259,13 +516,29 @@ func getObjectHandler(dynamicClient dynamic.Interface, cc *cachingClient) http.H
 			return
 		}
 
-		fsys, err := cc.getCatalogFS(context.Background(), cat)
+		metas, err := cc.queryMetas(r.Context(), cat, r.PathValue("schema"), r.PathValue("packageName"))
+		if errors.Is(err, errNoStatusURLs) {
+			fsys, _, err := cc.getCatalogFS(r.Context(), cat)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			http.ServeFileFS(uncompressedResponseWriter(w), r, fsys, filepath.Join(r.PathValue("packageName"), r.PathValue("schema"), r.PathValue("objectName")+".json"))
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		http.ServeFileFS(w, r, fsys, filepath.Join(r.PathValue("packageName"), r.PathValue("schema"), r.PathValue("objectName")+".json"))
+		for _, m := range metas {
+			if m.Name == r.PathValue("objectName") {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write(m.Blob)
+				return
+			}
+		}
+		http.Error(w, "object not found", http.StatusNotFound)
 	})
 }
 
@@ -282,7 +555,7 @@ func getPackageIconHandler(dynamicClient dynamic.Interface, cc *cachingClient) h
 			return
 		}
 
-		fsys, err := cc.getCatalogFS(context.Background(), cat)
+		fsys, _, err := cc.getCatalogFS(context.Background(), cat)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
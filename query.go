@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/alpha/property"
+)
+
+// listOptions are the standard Kubernetes-style list query parameters
+// understood by the list handlers: ?name=, ?nameGlob=, ?labelSelector=, and
+// ?limit=/?continue= for cursor pagination.
+type listOptions struct {
+	name          string
+	nameGlob      string
+	labelSelector labels.Selector
+	limit         int
+	cont          string
+}
+
+func parseListOptions(r *http.Request) (listOptions, error) {
+	q := r.URL.Query()
+	opts := listOptions{
+		name:     q.Get("name"),
+		nameGlob: q.Get("nameGlob"),
+		cont:     q.Get("continue"),
+	}
+	if raw := q.Get("labelSelector"); raw != "" {
+		sel, err := labels.Parse(raw)
+		if err != nil {
+			return listOptions{}, fmt.Errorf("parsing labelSelector: %w", err)
+		}
+		opts.labelSelector = sel
+	}
+	if raw := q.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 0 {
+			return listOptions{}, fmt.Errorf("invalid limit %q", raw)
+		}
+		opts.limit = limit
+	}
+	return opts, nil
+}
+
+// matchesName reports whether name passes the name and nameGlob filters.
+func (o listOptions) matchesName(name string) bool {
+	if o.name != "" && o.name != name {
+		return false
+	}
+	if o.nameGlob != "" {
+		ok, err := path.Match(o.nameGlob, name)
+		if err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesLabels reports whether m passes the labelSelector filter. An unset
+// selector matches every Meta; otherwise each olm.label property counts as a
+// label key with an empty value.
+func (o listOptions) matchesLabels(m declcfg.Meta) bool {
+	if o.labelSelector == nil {
+		return true
+	}
+	return o.labelSelector.Matches(metaLabelSet(m))
+}
+
+// metaLabelSet builds a labels.Set from a Meta's olm.label properties, the
+// FBC mechanism for attaching arbitrary labels to a package or bundle.
+func metaLabelSet(m declcfg.Meta) labels.Set {
+	set := labels.Set{}
+	for _, p := range m.Properties {
+		if p.Type != property.TypeLabel {
+			continue
+		}
+		var lbl property.Label
+		if err := json.Unmarshal(p.Value, &lbl); err != nil {
+			continue
+		}
+		set[lbl.Label] = ""
+	}
+	return set
+}
+
+// paginate applies continue/limit to an already-sorted, already-filtered
+// slice of names, returning the page and whether more results remain beyond
+// it.
+func paginate(names []string, o listOptions) (page []string, hasMore bool) {
+	start := 0
+	if o.cont != "" {
+		start = sort.SearchStrings(names, o.cont)
+		if start < len(names) && names[start] == o.cont {
+			start++
+		}
+	}
+	if start >= len(names) {
+		return nil, false
+	}
+	names = names[start:]
+	if o.limit <= 0 || o.limit >= len(names) {
+		return names, false
+	}
+	return names[:o.limit], true
+}
+
+// writeList JSON-encodes page, setting X-Total-Count to totalCount and, when
+// pagination trimmed the result, a Link: rel="next" header callers can
+// follow for the next page.
+func writeList(w http.ResponseWriter, r *http.Request, totalCount int, page any, lastName string, hasMore bool) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(totalCount))
+	if hasMore {
+		next := *r.URL
+		q := next.Query()
+		q.Set("continue", lastName)
+		next.RawQuery = q.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(page)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+)
+
+func TestParseListOptions(t *testing.T) {
+	r := httptest.NewRequest("GET", "/packages?name=foo&nameGlob=bar-*&labelSelector=env%3Dprod&limit=5&continue=foo", nil)
+	opts, err := parseListOptions(r)
+	if err != nil {
+		t.Fatalf("parseListOptions: %v", err)
+	}
+	if opts.name != "foo" || opts.nameGlob != "bar-*" || opts.limit != 5 || opts.cont != "foo" {
+		t.Errorf("unexpected options: %+v", opts)
+	}
+	if opts.labelSelector == nil || !opts.labelSelector.Matches(labels.Set{"env": "prod"}) {
+		t.Errorf("expected labelSelector to match env=prod, got %v", opts.labelSelector)
+	}
+}
+
+func TestParseListOptionsInvalidLimit(t *testing.T) {
+	r := httptest.NewRequest("GET", "/packages?limit=-1", nil)
+	if _, err := parseListOptions(r); err == nil {
+		t.Fatal("expected error for negative limit, got nil")
+	}
+	r = httptest.NewRequest("GET", "/packages?limit=notanumber", nil)
+	if _, err := parseListOptions(r); err == nil {
+		t.Fatal("expected error for non-numeric limit, got nil")
+	}
+}
+
+func TestParseListOptionsInvalidLabelSelector(t *testing.T) {
+	r := httptest.NewRequest("GET", "/packages?labelSelector=%20%3D%3D%3D", nil)
+	if _, err := parseListOptions(r); err == nil {
+		t.Fatal("expected error for invalid labelSelector, got nil")
+	}
+}
+
+func TestMatchesName(t *testing.T) {
+	cases := []struct {
+		opts listOptions
+		name string
+		want bool
+	}{
+		{listOptions{}, "anything", true},
+		{listOptions{name: "foo"}, "foo", true},
+		{listOptions{name: "foo"}, "bar", false},
+		{listOptions{nameGlob: "foo-*"}, "foo-bar", true},
+		{listOptions{nameGlob: "foo-*"}, "baz-bar", false},
+	}
+	for _, c := range cases {
+		if got := c.opts.matchesName(c.name); got != c.want {
+			t.Errorf("matchesName(%q) with %+v = %v, want %v", c.name, c.opts, got, c.want)
+		}
+	}
+}
+
+func metaWithLabel(t *testing.T, label string) declcfg.Meta {
+	t.Helper()
+	var m declcfg.Meta
+	data := []byte(`{"properties":[{"type":"olm.label","value":{"label":"` + label + `"}}]}`)
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("building test Meta: %v", err)
+	}
+	return m
+}
+
+func TestMatchesLabels(t *testing.T) {
+	labeled := metaWithLabel(t, "env/prod")
+	unlabeled := declcfg.Meta{}
+
+	opts, err := parseListOptions(httptest.NewRequest("GET", "/packages?labelSelector=env%2Fprod", nil))
+	if err != nil {
+		t.Fatalf("parseListOptions: %v", err)
+	}
+	if !opts.matchesLabels(labeled) {
+		t.Error("expected meta with matching olm.label property to match")
+	}
+	if opts.matchesLabels(unlabeled) {
+		t.Error("expected meta without the label to not match")
+	}
+
+	noSelector := listOptions{}
+	if !noSelector.matchesLabels(unlabeled) {
+		t.Error("expected an unset selector to match everything")
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	names := []string{"a", "b", "c", "d", "e"}
+
+	t.Run("no limit returns everything", func(t *testing.T) {
+		page, hasMore := paginate(names, listOptions{})
+		if hasMore || len(page) != len(names) {
+			t.Errorf("got page=%v hasMore=%v", page, hasMore)
+		}
+	})
+
+	t.Run("limit trims and reports hasMore", func(t *testing.T) {
+		page, hasMore := paginate(names, listOptions{limit: 2})
+		if !hasMore || len(page) != 2 || page[0] != "a" || page[1] != "b" {
+			t.Errorf("got page=%v hasMore=%v", page, hasMore)
+		}
+	})
+
+	t.Run("continue resumes after the given name", func(t *testing.T) {
+		page, hasMore := paginate(names, listOptions{cont: "b", limit: 2})
+		if !hasMore || len(page) != 2 || page[0] != "c" || page[1] != "d" {
+			t.Errorf("got page=%v hasMore=%v", page, hasMore)
+		}
+	})
+
+	t.Run("continue past the end returns nothing", func(t *testing.T) {
+		page, hasMore := paginate(names, listOptions{cont: "e"})
+		if hasMore || page != nil {
+			t.Errorf("got page=%v hasMore=%v", page, hasMore)
+		}
+	})
+
+	t.Run("continue on a name no longer present resumes after the insertion point", func(t *testing.T) {
+		page, hasMore := paginate(names, listOptions{cont: "bb"})
+		if hasMore || len(page) != 3 || page[0] != "c" {
+			t.Errorf("got page=%v hasMore=%v", page, hasMore)
+		}
+	})
+
+	t.Run("limit equal to remaining count reports no more", func(t *testing.T) {
+		page, hasMore := paginate(names, listOptions{limit: 5})
+		if hasMore || len(page) != 5 {
+			t.Errorf("got page=%v hasMore=%v", page, hasMore)
+		}
+	})
+}
+
+func TestSplitFields(t *testing.T) {
+	if got := splitFields(""); got != nil {
+		t.Errorf("expected nil for empty fields, got %v", got)
+	}
+	got := splitFields("name,description")
+	want := []string{"name", "description"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("splitFields() = %v, want %v", got, want)
+	}
+}
+
+func TestProjectPackageFields(t *testing.T) {
+	pkg := declcfg.Package{Name: "foo", DefaultChannel: "stable", Description: "a package", Schema: declcfg.SchemaPackage}
+	got := projectPackageFields(pkg, []string{"name", "defaultChannel", "unknownField"})
+	want := map[string]any{"name": "foo", "defaultChannel": "stable"}
+	gotJSON, _ := json.Marshal(got)
+	wantJSON, _ := json.Marshal(want)
+	if string(gotJSON) != string(wantJSON) {
+		t.Errorf("projectPackageFields() = %s, want %s", gotJSON, wantJSON)
+	}
+}
+
+func TestLastOf(t *testing.T) {
+	if got := lastOf(nil); got != "" {
+		t.Errorf("lastOf(nil) = %q, want empty", got)
+	}
+	if got := lastOf([]string{"a", "b"}); got != "b" {
+		t.Errorf("lastOf([a b]) = %q, want b", got)
+	}
+}
+
+func TestWriteList(t *testing.T) {
+	r := httptest.NewRequest("GET", "/packages?limit=2", nil)
+	w := httptest.NewRecorder()
+	writeList(w, r, 10, []string{"a", "b"}, "b", true)
+
+	if got := w.Header().Get("X-Total-Count"); got != "10" {
+		t.Errorf("X-Total-Count = %q, want 10", got)
+	}
+	link := w.Header().Get("Link")
+	if link == "" || !strings.Contains(link, `rel="next"`) {
+		t.Errorf("expected a Link header with rel=\"next\", got %q", link)
+	}
+	if !strings.Contains(link, "continue=b") {
+		t.Errorf("expected Link header to carry continue=b, got %q", link)
+	}
+
+	w2 := httptest.NewRecorder()
+	writeList(w2, r, 2, []string{"a", "b"}, "b", false)
+	if got := w2.Header().Get("Link"); got != "" {
+		t.Errorf("expected no Link header when hasMore is false, got %q", got)
+	}
+}
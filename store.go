@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing/fstest"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+// CatalogStore persists catalog snapshots so that cachingClient and its HTTP
+// handlers can read them back as an fs.FS without caring where the bytes
+// actually live. This is the same "extensible unpacker" shape catalogd uses
+// for its own bundle storage: one small interface, several interchangeable
+// backends.
+//
+// Implementations must be safe for concurrent use, since cachingClient may
+// serve overlapping requests for the same catalog.
+type CatalogStore interface {
+	// Snapshot returns the current active snapshot for name and the time it
+	// was produced. It returns an error satisfying errors.Is(err,
+	// fs.ErrNotExist) if name has no snapshot yet.
+	Snapshot(ctx context.Context, name string) (fs.FS, time.Time, error)
+
+	// BeginWrite opens a new snapshot for name stamped with modTime. The
+	// snapshot only becomes visible to Snapshot once CatalogWriter.Commit is
+	// called, so concurrent readers never see a partial write.
+	BeginWrite(ctx context.Context, name string, modTime time.Time) (CatalogWriter, error)
+}
+
+// CatalogWriter accumulates the files that make up one catalog snapshot.
+type CatalogWriter interface {
+	// WriteFile adds a file at path, relative to the catalog root, to the
+	// in-progress snapshot.
+	WriteFile(path string, data []byte) error
+
+	// Commit finalizes the in-progress snapshot, making it the new active
+	// snapshot returned by CatalogStore.Snapshot.
+	Commit() error
+
+	// Discard abandons the in-progress snapshot without making it active.
+	Discard() error
+}
+
+// newCatalogStore builds the CatalogStore selected by the -cache-backend
+// flag. The non-local parameters are ignored by backends that don't need
+// them.
+func newCatalogStore(backend, localRoot, s3Bucket, s3Prefix, s3Endpoint string) (CatalogStore, error) {
+	switch backend {
+	case "", "local":
+		return NewLocalDirStore(localRoot), nil
+	case "memory":
+		return NewInMemoryStore(), nil
+	case "s3":
+		if s3Bucket == "" {
+			return nil, fmt.Errorf("-cache-s3-bucket is required for the s3 cache backend")
+		}
+		return NewObjectStore(context.Background(), s3Bucket, s3Prefix, s3Endpoint)
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", backend)
+	}
+}
+
+// LocalDirStore persists catalog snapshots under root/clustercatalogs/<name>/<timestamp>,
+// with an "active" symlink pointing at the most recently committed snapshot.
+// This is the on-disk scheme cachingClient used before its storage was
+// extracted behind CatalogStore, and remains the default backend.
+type LocalDirStore struct {
+	root string
+	lru  *expirable.LRU[string, string]
+}
+
+func NewLocalDirStore(root string) *LocalDirStore {
+	lru := expirable.NewLRU(100, func(_ string, value string) {
+		os.RemoveAll(value)
+	}, time.Hour*24)
+	return &LocalDirStore{root: root, lru: lru}
+}
+
+func (s *LocalDirStore) catalogDir(name string) string {
+	return filepath.Join(s.root, "clustercatalogs", name)
+}
+
+func (s *LocalDirStore) Snapshot(_ context.Context, name string) (fs.FS, time.Time, error) {
+	catalogDir := s.catalogDir(name)
+	s.lru.Add(name, catalogDir)
+
+	activePath := filepath.Join(catalogDir, "active")
+	stat, err := os.Stat(activePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, time.Time{}, fs.ErrNotExist
+		}
+		return nil, time.Time{}, err
+	}
+	return os.DirFS(activePath), stat.ModTime(), nil
+}
+
+func (s *LocalDirStore) BeginWrite(_ context.Context, name string, modTime time.Time) (CatalogWriter, error) {
+	catalogDir := s.catalogDir(name)
+	snapshotDir := filepath.Join(catalogDir, modTime.UTC().Format("20060102_150405"))
+	if err := os.MkdirAll(snapshotDir, 0755); err != nil {
+		return nil, err
+	}
+	return &localDirWriter{catalogDir: catalogDir, snapshotDir: snapshotDir, modTime: modTime}, nil
+}
+
+type localDirWriter struct {
+	catalogDir  string
+	snapshotDir string
+	modTime     time.Time
+}
+
+func (w *localDirWriter) WriteFile(relPath string, data []byte) error {
+	full := filepath.Join(w.snapshotDir, relPath)
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(full, data, 0644)
+}
+
+func (w *localDirWriter) Commit() error {
+	if err := os.Chtimes(w.snapshotDir, w.modTime, w.modTime); err != nil {
+		return err
+	}
+	nextPath := filepath.Join(w.catalogDir, "next")
+	if err := os.Symlink(filepath.Base(w.snapshotDir), nextPath); err != nil {
+		return err
+	}
+	return os.Rename(nextPath, filepath.Join(w.catalogDir, "active"))
+}
+
+func (w *localDirWriter) Discard() error {
+	return os.RemoveAll(w.snapshotDir)
+}
+
+// InMemoryStore keeps every catalog snapshot as an fstest.MapFS. It's meant
+// for tests and for small deployments that don't need snapshots to survive a
+// restart.
+type InMemoryStore struct {
+	mu        sync.Mutex
+	snapshots map[string]inMemorySnapshot
+}
+
+type inMemorySnapshot struct {
+	fsys    fstest.MapFS
+	modTime time.Time
+}
+
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{snapshots: make(map[string]inMemorySnapshot)}
+}
+
+func (s *InMemoryStore) Snapshot(_ context.Context, name string) (fs.FS, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap, ok := s.snapshots[name]
+	if !ok {
+		return nil, time.Time{}, fs.ErrNotExist
+	}
+	return snap.fsys, snap.modTime, nil
+}
+
+func (s *InMemoryStore) BeginWrite(_ context.Context, name string, modTime time.Time) (CatalogWriter, error) {
+	return &inMemoryWriter{store: s, name: name, modTime: modTime, fsys: make(fstest.MapFS)}, nil
+}
+
+type inMemoryWriter struct {
+	store   *InMemoryStore
+	name    string
+	modTime time.Time
+	fsys    fstest.MapFS
+}
+
+func (w *inMemoryWriter) WriteFile(relPath string, data []byte) error {
+	w.fsys[relPath] = &fstest.MapFile{Data: data, ModTime: w.modTime}
+	return nil
+}
+
+func (w *inMemoryWriter) Commit() error {
+	w.store.mu.Lock()
+	defer w.store.mu.Unlock()
+	w.store.snapshots[w.name] = inMemorySnapshot{fsys: w.fsys, modTime: w.modTime}
+	return nil
+}
+
+func (w *inMemoryWriter) Discard() error {
+	return nil
+}
+
+// ObjectStore persists catalog snapshots to an S3-compatible bucket so that
+// multiple cachingClient replicas can share one copy of each catalog instead
+// of each downloading it from catalogd independently. The active snapshot
+// for a catalog is recorded as a small pointer object next to the snapshots
+// themselves, mirroring LocalDirStore's "active" symlink.
+type ObjectStore struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func NewObjectStore(ctx context.Context, bucket, prefix, endpoint string) (*ObjectStore, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS config: %w", err)
+	}
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+	})
+	return &ObjectStore{client: client, bucket: bucket, prefix: prefix}, nil
+}
+
+func (s *ObjectStore) catalogPrefix(name string) string {
+	return path.Join(s.prefix, "clustercatalogs", name)
+}
+
+// objectStoreSnapshotIDLayout is the format BeginWrite stamps the snapshotID
+// with, and the one Snapshot parses it back with to recover the catalog's
+// real modTime. It must match the modTime.UTC().Format call in BeginWrite.
+const objectStoreSnapshotIDLayout = "20060102_150405"
+
+func (s *ObjectStore) Snapshot(ctx context.Context, name string) (fs.FS, time.Time, error) {
+	activeKey := path.Join(s.catalogPrefix(name), "active")
+	activeObj, err := s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(activeKey)})
+	if err != nil {
+		var nsk *s3types.NoSuchKey
+		if errors.As(err, &nsk) {
+			return nil, time.Time{}, fs.ErrNotExist
+		}
+		return nil, time.Time{}, err
+	}
+	snapshotIDBytes, err := io.ReadAll(activeObj.Body)
+	activeObj.Body.Close()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	snapshotID := string(snapshotIDBytes)
+	modTime, err := time.Parse(objectStoreSnapshotIDLayout, snapshotID)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("parsing modTime from snapshot ID %q: %w", snapshotID, err)
+	}
+	snapshotPrefix := path.Join(s.catalogPrefix(name), snapshotID) + "/"
+
+	fsys := make(fstest.MapFS)
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(snapshotPrefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		for _, obj := range page.Contents {
+			objOut, err := s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: obj.Key})
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+			data, err := io.ReadAll(objOut.Body)
+			objOut.Body.Close()
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+			fsys[strings.TrimPrefix(*obj.Key, snapshotPrefix)] = &fstest.MapFile{Data: data}
+		}
+	}
+	return fsys, modTime, nil
+}
+
+func (s *ObjectStore) BeginWrite(ctx context.Context, name string, modTime time.Time) (CatalogWriter, error) {
+	return &objectWriter{
+		ctx:        ctx,
+		store:      s,
+		name:       name,
+		snapshotID: modTime.UTC().Format(objectStoreSnapshotIDLayout),
+	}, nil
+}
+
+type objectWriter struct {
+	ctx        context.Context
+	store      *ObjectStore
+	name       string
+	snapshotID string
+
+	// keys tracks every object written so far, so Discard can clean them
+	// back up if the snapshot never gets committed.
+	keys []string
+}
+
+func (w *objectWriter) WriteFile(relPath string, data []byte) error {
+	key := path.Join(w.store.catalogPrefix(w.name), w.snapshotID, relPath)
+	_, err := w.store.client.PutObject(w.ctx, &s3.PutObjectInput{
+		Bucket: aws.String(w.store.bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	})
+	if err != nil {
+		return err
+	}
+	w.keys = append(w.keys, key)
+	return nil
+}
+
+func (w *objectWriter) Commit() error {
+	activeKey := path.Join(w.store.catalogPrefix(w.name), "active")
+	_, err := w.store.client.PutObject(w.ctx, &s3.PutObjectInput{
+		Bucket: aws.String(w.store.bucket),
+		Key:    aws.String(activeKey),
+		Body:   strings.NewReader(w.snapshotID),
+	})
+	return err
+}
+
+func (w *objectWriter) Discard() error {
+	for _, key := range w.keys {
+		if _, err := w.store.client.DeleteObject(w.ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(w.store.bucket),
+			Key:    aws.String(key),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
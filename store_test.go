@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"testing"
+	"time"
+)
+
+func TestInMemoryStoreSnapshotNotExist(t *testing.T) {
+	s := NewInMemoryStore()
+	if _, _, err := s.Snapshot(context.Background(), "missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+}
+
+func TestInMemoryStoreWriteCommitSnapshot(t *testing.T) {
+	s := NewInMemoryStore()
+	ctx := context.Background()
+	modTime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	w, err := s.BeginWrite(ctx, "cat", modTime)
+	if err != nil {
+		t.Fatalf("BeginWrite: %v", err)
+	}
+	if err := w.WriteFile("pkg/olm.package/pkg.json", []byte(`{}`)); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := w.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	fsys, gotModTime, err := s.Snapshot(ctx, "cat")
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if !gotModTime.Equal(modTime) {
+		t.Errorf("expected modTime %v, got %v", modTime, gotModTime)
+	}
+	data, err := fs.ReadFile(fsys, "pkg/olm.package/pkg.json")
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(data) != `{}` {
+		t.Errorf("unexpected file contents: %s", data)
+	}
+}
+
+func TestInMemoryStoreDiscardedWriteNotVisible(t *testing.T) {
+	s := NewInMemoryStore()
+	ctx := context.Background()
+
+	w, err := s.BeginWrite(ctx, "cat", time.Now().UTC())
+	if err != nil {
+		t.Fatalf("BeginWrite: %v", err)
+	}
+	if err := w.WriteFile("pkg/olm.package/pkg.json", []byte(`{}`)); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := w.Discard(); err != nil {
+		t.Fatalf("Discard: %v", err)
+	}
+
+	if _, _, err := s.Snapshot(ctx, "cat"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist after discard, got %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"k8s.io/client-go/dynamic"
+)
+
+// watchEvent describes one add/remove/modify transition observed between two
+// snapshots of a watched scope.
+type watchEvent struct {
+	Type string `json:"type"` // "added", "removed", or "modified"
+	Name string `json:"name"`
+}
+
+// watchCatalogHandler streams added/removed events for a catalog's package
+// list as Server-Sent Events, pushed whenever cachingClient notices the
+// catalog's cached snapshot change.
+func watchCatalogHandler(dynamicClient dynamic.Interface, cc *cachingClient) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resource, catalogName := r.PathValue("resource"), r.PathValue("catalogName")
+		serveWatch(w, r, cc, catalogName, func() (map[string]string, error) {
+			cat, err := getClusterCatalog(r.Context(), dynamicClient, resource, catalogName)
+			if err != nil {
+				return nil, err
+			}
+			names, err := currentPackageNames(r.Context(), cc, cat)
+			if err != nil {
+				return nil, err
+			}
+			state := make(map[string]string, len(names))
+			for _, name := range names {
+				state[name] = ""
+			}
+			return state, nil
+		})
+	})
+}
+
+// watchPackageHandler streams added/removed/modified events for every object
+// in a package, across all its schemas, as Server-Sent Events. Objects are
+// diffed by blob content so an in-place edit is reported as "modified"
+// rather than a remove+add pair.
+func watchPackageHandler(dynamicClient dynamic.Interface, cc *cachingClient) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resource, catalogName, packageName := r.PathValue("resource"), r.PathValue("catalogName"), r.PathValue("packageName")
+		serveWatch(w, r, cc, catalogName, func() (map[string]string, error) {
+			cat, err := getClusterCatalog(r.Context(), dynamicClient, resource, catalogName)
+			if err != nil {
+				return nil, err
+			}
+			metas, err := cc.queryMetas(r.Context(), cat, "", packageName)
+			if err != nil {
+				return nil, err
+			}
+			state := make(map[string]string, len(metas))
+			for _, m := range metas {
+				state[m.Schema+"/"+m.Name] = string(m.Blob)
+			}
+			return state, nil
+		})
+	})
+}
+
+// serveWatch upgrades the request to a Server-Sent Events stream. It sends
+// the current scope as a burst of "added" events, then blocks until
+// catalogName's cached snapshot changes, re-fetches the scope via fetch, and
+// emits whatever added/removed/modified events the diff produces. It runs
+// until the client disconnects.
+func serveWatch(w http.ResponseWriter, r *http.Request, cc *cachingClient, catalogName string, fetch func() (map[string]string, error)) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	changes, cancel := cc.Subscribe(catalogName)
+	defer cancel()
+
+	prev := map[string]string{}
+	for {
+		next, err := fetch()
+		if err != nil {
+			writeSSE(w, "error", err.Error())
+			flusher.Flush()
+			return
+		}
+		for _, ev := range diffWatchState(prev, next) {
+			if err := writeSSEEvent(w, ev); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+		prev = next
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-changes:
+		}
+	}
+}
+
+func diffWatchState(prev, next map[string]string) []watchEvent {
+	var events []watchEvent
+	for name, content := range next {
+		prevContent, existed := prev[name]
+		switch {
+		case !existed:
+			events = append(events, watchEvent{Type: "added", Name: name})
+		case prevContent != content:
+			events = append(events, watchEvent{Type: "modified", Name: name})
+		}
+	}
+	for name := range prev {
+		if _, stillPresent := next[name]; !stillPresent {
+			events = append(events, watchEvent{Type: "removed", Name: name})
+		}
+	}
+	return events
+}
+
+func writeSSEEvent(w http.ResponseWriter, ev watchEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
+
+func writeSSE(w http.ResponseWriter, event, data string) {
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http/httptest"
+	"sort"
+	"testing"
+)
+
+func TestDiffWatchState(t *testing.T) {
+	cases := []struct {
+		name string
+		prev map[string]string
+		next map[string]string
+		want []watchEvent
+	}{
+		{
+			name: "added",
+			prev: map[string]string{},
+			next: map[string]string{"a": "v1"},
+			want: []watchEvent{{Type: "added", Name: "a"}},
+		},
+		{
+			name: "removed",
+			prev: map[string]string{"a": "v1"},
+			next: map[string]string{},
+			want: []watchEvent{{Type: "removed", Name: "a"}},
+		},
+		{
+			name: "modified on content change",
+			prev: map[string]string{"a": "v1"},
+			next: map[string]string{"a": "v2"},
+			want: []watchEvent{{Type: "modified", Name: "a"}},
+		},
+		{
+			name: "unchanged content produces no event",
+			prev: map[string]string{"a": "v1"},
+			next: map[string]string{"a": "v1"},
+			want: nil,
+		},
+		{
+			name: "mixed add, remove, and modify in one diff",
+			prev: map[string]string{"a": "v1", "b": "v1", "c": "v1"},
+			next: map[string]string{"a": "v1", "b": "v2", "d": "v1"},
+			want: []watchEvent{
+				{Type: "added", Name: "d"},
+				{Type: "modified", Name: "b"},
+				{Type: "removed", Name: "c"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := diffWatchState(c.prev, c.next)
+			sortEvents(got)
+			sortEvents(c.want)
+			if !eventsEqual(got, c.want) {
+				t.Errorf("diffWatchState(%v, %v) = %v, want %v", c.prev, c.next, got, c.want)
+			}
+		})
+	}
+}
+
+func sortEvents(events []watchEvent) {
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Name != events[j].Name {
+			return events[i].Name < events[j].Name
+		}
+		return events[i].Type < events[j].Type
+	})
+}
+
+func eventsEqual(a, b []watchEvent) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestWriteSSEEvent(t *testing.T) {
+	w := httptest.NewRecorder()
+	if err := writeSSEEvent(w, watchEvent{Type: "added", Name: "pkg-a"}); err != nil {
+		t.Fatalf("writeSSEEvent: %v", err)
+	}
+	want := "data: {\"type\":\"added\",\"name\":\"pkg-a\"}\n\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("writeSSEEvent output = %q, want %q", got, want)
+	}
+}
+
+func TestWriteSSE(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeSSE(w, "error", "boom")
+	want := "event: error\ndata: boom\n\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("writeSSE output = %q, want %q", got, want)
+	}
+}